@@ -0,0 +1,47 @@
+// Package collector abstracts how EdgeGuard gathers the raw hardware
+// data it fingerprints, so the agent isn't hard-wired to the HAL
+// sidecar. Backends are selected at runtime via the COLLECTOR env var
+// (hal, gopsutil, or composite) and all satisfy HardwareCollector.
+package collector
+
+import (
+	"context"
+	"fmt"
+)
+
+// HardwareData is the set of readings EdgeGuard fingerprints. It mirrors
+// the shape HAL has always returned; backends that source data
+// differently (e.g. gopsutil) populate the same fields from their own
+// queries so the rest of the agent doesn't need to care where a reading
+// came from.
+type HardwareData struct {
+	Lscpu   map[string]interface{} `json:"lscpu"`
+	Lspci   map[string]interface{} `json:"lspci"`
+	Lsusb   map[string]interface{} `json:"lsusb"`
+	Lshw    map[string]interface{} `json:"lshw"`
+	CpuInfo map[string]interface{} `json:"cpuinfo"`
+}
+
+// HardwareCollector gathers a HardwareData reading from whatever source
+// a backend wraps. ctx carries the caller's timeout/cancellation and,
+// when tracing is enabled, the span the backend's work should nest
+// under.
+type HardwareCollector interface {
+	Collect(ctx context.Context) (*HardwareData, error)
+}
+
+// New builds the collector selected by COLLECTOR: "hal" (default),
+// "gopsutil", or "composite" (both, merged). baseURL is only used by the
+// hal backend.
+func New(kind, baseURL string) (HardwareCollector, error) {
+	switch kind {
+	case "", "hal":
+		return NewHAL(baseURL), nil
+	case "gopsutil":
+		return NewGopsutil(), nil
+	case "composite":
+		return NewComposite(NewHAL(baseURL), NewGopsutil()), nil
+	default:
+		return nil, fmt.Errorf("unknown COLLECTOR %q: must be hal, gopsutil, or composite", kind)
+	}
+}
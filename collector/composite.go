@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+)
+
+// CompositeCollector merges the readings from multiple backends into a
+// single HardwareData, so e.g. CPU/board data from HAL can be combined
+// with NIC/disk data gopsutil reads more reliably.
+type CompositeCollector struct {
+	sources []HardwareCollector
+}
+
+// NewComposite returns a HardwareCollector that merges the readings of
+// all sources, in order: within each field, keys from later sources
+// overwrite the same keys from earlier ones, and empty fields are skipped.
+func NewComposite(sources ...HardwareCollector) *CompositeCollector {
+	return &CompositeCollector{sources: sources}
+}
+
+// Collect merges the readings of every source, tolerating any individual
+// source failing: a host without HAL deployed, the exact case this
+// collector exists for, would otherwise fail composite mode on every
+// single call. It only errors if every source failed, since at that
+// point there's nothing left to merge.
+func (c *CompositeCollector) Collect(ctx context.Context) (*HardwareData, error) {
+	merged := &HardwareData{}
+	succeeded := 0
+
+	for _, source := range c.sources {
+		data, err := source.Collect(ctx)
+		if err != nil {
+			logger.WarnContext(ctx, "composite collector: source failed, skipping it", "source", fmt.Sprintf("%T", source), "error", err)
+			continue
+		}
+		mergeInto(merged, data)
+		succeeded++
+	}
+
+	if succeeded == 0 {
+		return nil, fmt.Errorf("composite collector: all %d sources failed", len(c.sources))
+	}
+
+	return merged, nil
+}
+
+func mergeInto(dst, src *HardwareData) {
+	if len(src.Lscpu) > 0 {
+		dst.Lscpu = mergeMaps(dst.Lscpu, src.Lscpu)
+	}
+	if len(src.Lspci) > 0 {
+		dst.Lspci = mergeMaps(dst.Lspci, src.Lspci)
+	}
+	if len(src.Lsusb) > 0 {
+		dst.Lsusb = mergeMaps(dst.Lsusb, src.Lsusb)
+	}
+	if len(src.Lshw) > 0 {
+		dst.Lshw = mergeMaps(dst.Lshw, src.Lshw)
+	}
+	if len(src.CpuInfo) > 0 {
+		dst.CpuInfo = mergeMaps(dst.CpuInfo, src.CpuInfo)
+	}
+}
+
+func mergeMaps(dst, src map[string]interface{}) map[string]interface{} {
+	if dst == nil {
+		dst = map[string]interface{}{}
+	}
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/mem"
+	"github.com/shirou/gopsutil/v3/net"
+
+	"github.com/Datasance/EdgeGuard/internal/telemetry"
+)
+
+// GopsutilCollector gathers hardware data directly from the host via
+// gopsutil, with no dependency on the HAL sidecar being deployed.
+type GopsutilCollector struct{}
+
+// NewGopsutil returns a HardwareCollector backed by gopsutil.
+func NewGopsutil() *GopsutilCollector {
+	return &GopsutilCollector{}
+}
+
+func (g *GopsutilCollector) Collect(ctx context.Context) (*HardwareData, error) {
+	_, span := telemetry.Tracer.Start(ctx, "collector.GopsutilCollector.Collect")
+	defer span.End()
+
+	cpuInfo, err := cpu.Info()
+	if err != nil {
+		return nil, fmt.Errorf("gopsutil cpu.Info: %w", err)
+	}
+	hostInfo, err := host.Info()
+	if err != nil {
+		return nil, fmt.Errorf("gopsutil host.Info: %w", err)
+	}
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, fmt.Errorf("gopsutil disk.Partitions: %w", err)
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("gopsutil net.Interfaces: %w", err)
+	}
+	vmem, err := mem.VirtualMemory()
+	if err != nil {
+		return nil, fmt.Errorf("gopsutil mem.VirtualMemory: %w", err)
+	}
+
+	diskSerials := make([]string, 0, len(partitions))
+	for _, p := range partitions {
+		diskSerials = append(diskSerials, p.Device)
+	}
+	macs := make([]string, 0, len(ifaces))
+	for _, iface := range ifaces {
+		if iface.HardwareAddr != "" {
+			macs = append(macs, iface.HardwareAddr)
+		}
+	}
+
+	return &HardwareData{
+		Lscpu: map[string]interface{}{"cpu_info": cpuInfo},
+		// Nested under the same system/network/disk/memory keys
+		// fingerprint.componentSpecs looks for, so board/mac/disk/
+		// memory are hashed as independent components instead of
+		// all collapsing onto one "whole Lshw blob" hash.
+		Lshw: map[string]interface{}{
+			"system":  hostInfo,
+			"network": macs,
+			"disk":    diskSerials,
+			"memory":  vmem,
+		},
+		Lsusb:   map[string]interface{}{}, // gopsutil has no USB enumeration; left empty.
+		Lspci:   map[string]interface{}{}, // gopsutil has no PCI enumeration; left empty.
+		CpuInfo: map[string]interface{}{},
+	}, nil
+}
@@ -0,0 +1,171 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Datasance/EdgeGuard/internal/resilience"
+	"github.com/Datasance/EdgeGuard/internal/telemetry"
+)
+
+const (
+	defaultHALPort = "54331"
+
+	defaultHALTimeout = 5 * time.Second
+	defaultHALRetries = 3
+	retryBaseDelay    = 200 * time.Millisecond
+	retryMaxDelay     = 5 * time.Second
+
+	breakerThreshold = 5
+	breakerCooldown  = 30 * time.Second
+)
+
+var halEndpoints = []string{"lscpu", "lspci", "lsusb", "lshw", "proc/cpuinfo"}
+
+var logger = telemetry.NewLogger()
+
+// HALCollector gathers hardware data from the HAL sidecar's HTTP API
+// (http://<baseURL>:54331/hal/hwc/...), the way EdgeGuard always has.
+// It times out and retries individual fetches, fetches all endpoints
+// concurrently, and trips a circuit breaker after repeated failures so
+// a hung or down HAL can't freeze or busy-loop the agent.
+type HALCollector struct {
+	baseURL string
+	client  *http.Client
+	timeout time.Duration
+	retries int
+	breaker *resilience.Breaker
+}
+
+// NewHAL returns a HardwareCollector backed by the HAL sidecar at
+// baseURL. Per-request timeout and attempt count are read from
+// HAL_TIMEOUT (seconds) and HAL_RETRIES; HAL_RETRIES is the total
+// number of attempts per endpoint, including the first one.
+func NewHAL(baseURL string) *HALCollector {
+	timeout := defaultHALTimeout
+	if v, err := strconv.Atoi(os.Getenv("HAL_TIMEOUT")); err == nil && v > 0 {
+		timeout = time.Duration(v) * time.Second
+	}
+
+	retries := defaultHALRetries
+	if v, err := strconv.Atoi(os.Getenv("HAL_RETRIES")); err == nil && v > 0 {
+		retries = v
+	}
+
+	return &HALCollector{
+		baseURL: baseURL,
+		client:  &http.Client{Timeout: timeout},
+		timeout: timeout,
+		retries: retries,
+		breaker: resilience.NewBreaker(breakerThreshold, breakerCooldown, logBreakerTransition),
+	}
+}
+
+func logBreakerTransition(from, to resilience.State) {
+	logger.Warn("HAL circuit breaker state changed", "from", from.String(), "to", to.String())
+}
+
+// Collect fetches all five HAL endpoints concurrently. If the circuit
+// breaker is open it skips the entire iteration immediately instead of
+// busy-looping on a HAL that's known to be down.
+func (h *HALCollector) Collect(ctx context.Context) (*HardwareData, error) {
+	ctx, span := telemetry.Tracer.Start(ctx, "collector.HALCollector.Collect")
+	defer span.End()
+
+	if !h.breaker.Allow() {
+		return nil, fmt.Errorf("HAL circuit breaker open, skipping this iteration")
+	}
+
+	results := make(map[string]interface{}, len(halEndpoints))
+	var mu sync.Mutex
+
+	group, gctx := errgroup.WithContext(ctx)
+	for _, endpoint := range halEndpoints {
+		endpoint := endpoint
+		group.Go(func() error {
+			url := fmt.Sprintf("http://%s:%s/hal/hwc/%s", h.baseURL, defaultHALPort, endpoint)
+			result, err := h.fetchWithRetry(gctx, endpoint, url)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			results[endpoint] = result
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		h.breaker.RecordFailure()
+		return nil, err
+	}
+	h.breaker.RecordSuccess()
+
+	return &HardwareData{
+		Lscpu:   parseToMap(results["lscpu"]),
+		Lspci:   parseToMap(results["lspci"]),
+		Lsusb:   parseToMap(results["lsusb"]),
+		Lshw:    parseToMap(results["lshw"]),
+		CpuInfo: parseToMap(results["proc/cpuinfo"]),
+	}, nil
+}
+
+// fetchWithRetry fetches one HAL endpoint, retrying with jittered
+// exponential backoff on failure.
+func (h *HALCollector) fetchWithRetry(ctx context.Context, endpoint, url string) (interface{}, error) {
+	var result interface{}
+	err := resilience.Retry(ctx, h.retries, retryBaseDelay, retryMaxDelay, func() error {
+		var fetchErr error
+		result, fetchErr = h.fetchEndpoint(ctx, endpoint, url)
+		return fetchErr
+	})
+	return result, err
+}
+
+func (h *HALCollector) fetchEndpoint(ctx context.Context, endpoint, url string) (interface{}, error) {
+	ctx, span := telemetry.Tracer.Start(ctx, "collector.fetchEndpoint", trace.WithAttributes(attribute.String("hal.endpoint", endpoint)))
+	defer span.End()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request for %s: %w", url, err)
+	}
+
+	resp, err := h.client.Do(req)
+	telemetry.HALFetchDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response from %s: %w", url, err)
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON from %s: %w", url, err)
+	}
+
+	return data, nil
+}
+
+func parseToMap(data interface{}) map[string]interface{} {
+	if resultMap, ok := data.(map[string]interface{}); ok {
+		return resultMap
+	}
+	return map[string]interface{}{"data": data}
+}
@@ -2,35 +2,45 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+
+	"github.com/Datasance/EdgeGuard/collector"
+	"github.com/Datasance/EdgeGuard/internal/attest"
+	"github.com/Datasance/EdgeGuard/internal/challenge"
+	"github.com/Datasance/EdgeGuard/internal/fingerprint"
+	"github.com/Datasance/EdgeGuard/internal/telemetry"
 )
 
 const (
-	defaultHALURL  = "iofog"
-	defaultPort    = "54331"
-	deprovisionURL = "http://iofog:54321/v2/deprovision"
-	defaultPeriod  = 60 // Default to 1 minute if PERIOD is not set
-	saltFile       = "id/salt-key"
-	hwidFile       = "id/hw-id"
+	defaultHALURL      = "iofog"
+	deprovisionURL     = "http://iofog:54321/v2/deprovision"
+	attestURL          = "http://iofog:54321/v2/attest"
+	challengeURL       = "http://iofog:54321/v2/hwid-challenge"
+	defaultPeriod      = 60 // Default to 1 minute if PERIOD is not set
+	defaultMetricsAddr = ":9090"
+	saltFile           = "id/salt-key"
+	componentsFile     = "id/hw-components.json"
+	agentKeyFile       = "id/agent-key"
+	tpmDevice          = "/dev/tpmrm0"
+	deprovisionScore   = 0 // any changed "deprovision"-policy component triggers deprovisioning
+	defaultMaxAttempts = 5 // default MAX_CHALLENGE_ATTEMPTS
+	challengeBaseDelay = 5 * time.Second
+	challengeMaxDelay  = 5 * time.Minute
 )
 
-type HardwareData struct {
-	Lscpu   map[string]interface{} `json:"lscpu"`
-	Lspci   map[string]interface{} `json:"lspci"`
-	Lsusb   map[string]interface{} `json:"lsusb"`
-	Lshw    map[string]interface{} `json:"lshw"`
-	CpuInfo map[string]interface{} `json:"cpuinfo"`
-}
+var logger = telemetry.NewLogger()
 
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -39,103 +49,184 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func fetchEndpoint(url string) (interface{}, error) {
-	resp, err := http.Get(url)
+func generateSalt() (string, error) {
+	salt := make([]byte, 16) // 16-byte salt
+	_, err := rand.Read(salt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+		return "", fmt.Errorf("failed to generate salt: %w", err)
 	}
-	defer resp.Body.Close()
+	return base64.StdEncoding.EncodeToString(salt), nil
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
+func saveToFile(filename, data string) error {
+	return ioutil.WriteFile(filename, []byte(data), 0600)
+}
+
+func loadFromFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response from %s: %w", url, err)
+		return "", err
 	}
+	return string(bytes.TrimSpace(data)), nil
+}
 
-	var data interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON from %s: %w", url, err)
+// loadOrCreateSalt returns the persisted salt, generating and saving a
+// new one on first run.
+func loadOrCreateSalt() (string, error) {
+	salt, err := loadFromFile(saltFile)
+	if err == nil {
+		return salt, nil
 	}
 
-	return data, nil
+	logger.Info("salt not found, generating new one")
+	salt, err = generateSalt()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if err := saveToFile(saltFile, salt); err != nil {
+		return "", fmt.Errorf("failed to save salt to file: %w", err)
+	}
+	return salt, nil
 }
 
-func collectHardwareData(baseURL string) (*HardwareData, error) {
-	endpoints := []string{"lscpu", "lspci", "lsusb", "lshw", "proc/cpuinfo"}
-	data := &HardwareData{}
+// attestHardware performs the TPM-backed attestation flow: it extends
+// PCRIndex with the digest of the collected hardware data, quotes that
+// PCR over a controller-supplied nonce, and POSTs the envelope to
+// attestURL alongside the salted hash. It is only invoked when
+// ATTESTATION=tpm; if the TPM device cannot be opened (or any later
+// step fails) it returns an error and the caller falls back to the
+// existing hash-only reporting.
+func attestHardware(ctx context.Context, hwID string, data *collector.HardwareData) error {
+	ctx, span := telemetry.Tracer.Start(ctx, "attestHardware")
+	defer span.End()
+
+	rwc, err := tpm2.OpenTPM(tpmDevice)
+	if err != nil {
+		return fmt.Errorf("failed to open TPM device %s: %w", tpmDevice, err)
+	}
+	defer rwc.Close()
 
-	for _, endpoint := range endpoints {
-		url := fmt.Sprintf("http://%s:%s/hal/hwc/%s", baseURL, defaultPort, endpoint)
-		result, err := fetchEndpoint(url)
-		if err != nil {
-			return nil, err
-		}
+	ak, err := attest.LoadOrCreateAK(rwc)
+	if err != nil {
+		return fmt.Errorf("failed to load/create AK: %w", err)
+	}
 
-		switch endpoint {
-		case "lscpu":
-			data.Lscpu = parseToMap(result)
-		case "lspci":
-			data.Lspci = parseToMap(result)
-		case "lsusb":
-			data.Lsusb = parseToMap(result)
-		case "lshw":
-			data.Lshw = parseToMap(result)
-		case "proc/cpuinfo":
-			data.CpuInfo = parseToMap(result)
-		}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to serialize hardware data: %w", err)
+	}
+	if err := attest.ExtendHardwareDigest(rwc, jsonData); err != nil {
+		return fmt.Errorf("failed to extend PCR with hardware digest: %w", err)
 	}
 
-	return data, nil
-}
+	nonce, err := fetchAttestNonce(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to fetch attestation nonce: %w", err)
+	}
 
-func parseToMap(data interface{}) map[string]interface{} {
-	if resultMap, ok := data.(map[string]interface{}); ok {
-		return resultMap
+	quote, err := attest.GenerateQuote(rwc, ak, nonce)
+	if err != nil {
+		return fmt.Errorf("failed to generate TPM quote: %w", err)
+	}
+
+	envelope := attest.Envelope{
+		HWID:         hwID,
+		HardwareData: jsonData,
+		PCRValues:    quote.PCRValues,
+		Quote:        quote.Attested,
+		Signature:    quote.Signature,
+		AKPub:        ak.Public,
 	}
-	return map[string]interface{}{"data": data}
+	return postAttestEnvelope(ctx, envelope)
 }
 
-func generateSalt() (string, error) {
-	salt := make([]byte, 16) // 16-byte salt
-	_, err := rand.Read(salt)
+// fetchAttestNonce asks the controller for the nonce to bind the next
+// quote to, preventing a captured quote from being replayed later.
+func fetchAttestNonce(ctx context.Context) ([]byte, error) {
+	ctx, span := telemetry.Tracer.Start(ctx, "fetchAttestNonce")
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, attestURL+"/nonce", nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to generate salt: %w", err)
+		return nil, fmt.Errorf("failed to build nonce request: %w", err)
 	}
-	return base64.StdEncoding.EncodeToString(salt), nil
-}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attestation nonce: %w", err)
+	}
+	defer resp.Body.Close()
 
-func saveToFile(filename, data string) error {
-	return ioutil.WriteFile(filename, []byte(data), 0600)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nonce response: %w", err)
+	}
+	return body, nil
 }
 
-func loadFromFile(filename string) (string, error) {
-	data, err := ioutil.ReadFile(filename)
+func postAttestEnvelope(ctx context.Context, envelope attest.Envelope) error {
+	ctx, span := telemetry.Tracer.Start(ctx, "postAttestEnvelope")
+	defer span.End()
+
+	body, err := json.Marshal(envelope)
 	if err != nil {
-		return "", err
+		return fmt.Errorf("failed to serialize attestation envelope: %w", err)
 	}
-	return string(bytes.TrimSpace(data)), nil
-}
 
-func calculateSaltedHash(data *HardwareData) (string, error) {
-	jsonData, err := json.Marshal(data)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, attestURL, bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to serialize hardware data: %w", err)
+		return fmt.Errorf("failed to build attestation request: %w", err)
 	}
+	req.Header.Set("Content-Type", "application/json")
 
-	salt, err := loadFromFile(saltFile)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Println("Salt not found, generating new one.")
-		salt, err = generateSalt()
+		return fmt.Errorf("failed to POST attestation envelope: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("controller rejected attestation envelope: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runChallenge asks the controller whether a hardware change from
+// oldHWID to newHWID should be accepted. It returns true if the
+// controller approved the change (the caller should adopt newHWID as
+// the baseline), false if it was rejected or confirmation attempts were
+// exhausted (the caller should deprovision).
+func runChallenge(ctx context.Context, priv ed25519.PrivateKey, oldHWID, newHWID string, diffs []fingerprint.ComponentDiff, maxAttempts int) (bool, error) {
+	ctx, span := telemetry.Tracer.Start(ctx, "runChallenge")
+	defer span.End()
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		req, err := challenge.NewRequest(priv, oldHWID, newHWID, diffs)
+		if err != nil {
+			return false, fmt.Errorf("failed to build challenge request: %w", err)
+		}
+
+		resp, err := challenge.Post(challengeURL, req)
 		if err != nil {
-			return "", fmt.Errorf("failed to generate salt: %w", err)
+			logger.ErrorContext(ctx, "error posting re-enrollment challenge", "attempt", attempt+1, "max_attempts", maxAttempts, "error", err)
+			time.Sleep(challenge.Backoff(attempt, challengeBaseDelay, challengeMaxDelay))
+			continue
 		}
-		if err := saveToFile(saltFile, salt); err != nil {
-			return "", fmt.Errorf("failed to save salt to file: %w", err)
+
+		switch resp.Decision {
+		case challenge.DecisionApprove:
+			return true, nil
+		case challenge.DecisionReject:
+			return false, nil
+		case challenge.DecisionConfirm:
+			logger.InfoContext(ctx, "re-enrollment challenge pending operator confirmation", "attempt", attempt+1, "max_attempts", maxAttempts)
+			time.Sleep(challenge.Backoff(attempt, challengeBaseDelay, challengeMaxDelay))
+		default:
+			return false, fmt.Errorf("unknown challenge decision %q", resp.Decision)
 		}
 	}
 
-	saltedData := append([]byte(salt), jsonData...)
-	hash := sha256.Sum256(saltedData)
-	return fmt.Sprintf("%x", hash), nil
+	logger.WarnContext(ctx, "re-enrollment challenge exhausted attempts without confirmation; proceeding to deprovision", "max_attempts", maxAttempts)
+	return false, nil
 }
 
 func loadAuthToken() (string, error) {
@@ -146,81 +237,204 @@ func loadAuthToken() (string, error) {
 	return string(bytes.TrimSpace(token)), nil
 }
 
-func deprovisionDevice(authToken string) error {
-	req, err := http.NewRequest(http.MethodDelete, deprovisionURL, nil)
+func deprovisionDevice(ctx context.Context, authToken string) error {
+	ctx, span := telemetry.Tracer.Start(ctx, "deprovisionDevice")
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, deprovisionURL, nil)
 	if err != nil {
+		telemetry.DeprovisionAttemptsTotal.WithLabelValues("error").Inc()
 		return fmt.Errorf("failed to create DELETE request: %w", err)
 	}
 	req.Header.Set("Authorization", authToken)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		telemetry.DeprovisionAttemptsTotal.WithLabelValues("error").Inc()
 		return fmt.Errorf("failed to send DELETE request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		telemetry.DeprovisionAttemptsTotal.WithLabelValues("error").Inc()
 		return fmt.Errorf("unexpected response status: %d", resp.StatusCode)
 	}
 
+	telemetry.DeprovisionAttemptsTotal.WithLabelValues("success").Inc()
 	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify-attestation" {
+		if err := runVerifier(os.Args[2:]); err != nil {
+			logger.Error("attestation verification failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx := context.Background()
+
+	shutdownTracer, err := telemetry.InitTracer(ctx)
+	if err != nil {
+		logger.Error("failed to initialize tracing", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracer(ctx)
+
+	metricsServer := telemetry.StartMetricsServer(getEnv("METRICS_ADDR", defaultMetricsAddr), func(format string, args ...interface{}) {
+		logger.Error(fmt.Sprintf(format, args...))
+	})
+	defer metricsServer.Shutdown(ctx)
+
+	attestationMode := getEnv("ATTESTATION", "none")
+
 	halURL := getEnv("HAL_URL", defaultHALURL)
 	periodEnv := getEnv("PERIOD", strconv.Itoa(defaultPeriod))
 	period, err := strconv.Atoi(periodEnv)
 	if err != nil || period <= 0 {
-		log.Printf("Invalid PERIOD value, using default: %d seconds", defaultPeriod)
+		logger.Warn("invalid PERIOD value, using default", "default_seconds", defaultPeriod)
 		period = defaultPeriod
 	}
+	telemetry.CurrentPeriod.Set(float64(period))
 
-	initialHdID, err := loadFromFile(hwidFile)
+	hwCollector, err := collector.New(getEnv("COLLECTOR", "hal"), halURL)
 	if err != nil {
-		log.Println("HWID not found, will calculate on first run.")
+		logger.Error("invalid COLLECTOR configuration", "error", err)
+		os.Exit(1)
+	}
+
+	tolerance, err := fingerprint.ParseTolerance(getEnv("TOLERANCE", ""))
+	if err != nil {
+		logger.Error("invalid TOLERANCE configuration", "error", err)
+		os.Exit(1)
+	}
+
+	salt, err := loadOrCreateSalt()
+	if err != nil {
+		logger.Error("error loading salt", "error", err)
+		os.Exit(1)
+	}
+
+	baseline, err := fingerprint.LoadBaseline(componentsFile)
+	if err != nil {
+		logger.Error("error loading component baseline", "error", err)
+		os.Exit(1)
+	}
+
+	agentKey, err := challenge.LoadOrCreateKey(agentKeyFile)
+	if err != nil {
+		logger.Error("error loading agent key", "error", err)
+		os.Exit(1)
+	}
+
+	maxAttemptsEnv := getEnv("MAX_CHALLENGE_ATTEMPTS", strconv.Itoa(defaultMaxAttempts))
+	maxAttempts, err := strconv.Atoi(maxAttemptsEnv)
+	if err != nil || maxAttempts <= 0 {
+		logger.Warn("invalid MAX_CHALLENGE_ATTEMPTS value, using default", "default", defaultMaxAttempts)
+		maxAttempts = defaultMaxAttempts
 	}
 
 	for {
-		hardwareData, err := collectHardwareData(halURL)
+		iterCtx, iterSpan := telemetry.Tracer.Start(ctx, "checkIteration")
+
+		hardwareData, err := hwCollector.Collect(iterCtx)
 		if err != nil {
-			log.Printf("Error collecting hardware data: %v", err)
+			logger.ErrorContext(iterCtx, "error collecting hardware data", "error", err)
+			iterSpan.End()
+			time.Sleep(time.Duration(period) * time.Second) // avoid busy-looping while HAL/collector is unhealthy
 			continue
 		}
 
-		hwID, err := calculateSaltedHash(hardwareData)
+		fp, err := fingerprint.Compute(iterCtx, hardwareData, salt, tolerance)
 		if err != nil {
-			log.Printf("Error calculating hardware hash: %v", err)
+			logger.ErrorContext(iterCtx, "error computing hardware fingerprint", "error", err)
+			iterSpan.End()
+			time.Sleep(time.Duration(period) * time.Second)
 			continue
 		}
-		log.Printf("Calculated hardware hash: %s", hwID)
+		telemetry.HWIDChecksTotal.Inc()
+		telemetry.LastCheckTimestamp.SetToCurrentTime()
+		logger.InfoContext(iterCtx, "computed hardware fingerprint", "hwid", fp.CompositeID)
 
-		if initialHdID == "" {
-			initialHdID = hwID
-			if err := saveToFile(hwidFile, hwID); err != nil {
-				log.Printf("Error saving HWID to file: %v", err)
+		if attestationMode == "tpm" {
+			if err := attestHardware(iterCtx, fp.CompositeID, hardwareData); err != nil {
+				logger.WarnContext(iterCtx, "TPM attestation unavailable, falling back to hash-only reporting", "error", err)
 			}
-			log.Println("Initial hardware ID set.")
+		}
+
+		if baseline == nil {
+			baseline = fp
+			if err := fingerprint.SaveBaseline(componentsFile, fp); err != nil {
+				logger.ErrorContext(iterCtx, "error saving component baseline", "error", err)
+			}
+			logger.InfoContext(iterCtx, "initial hardware component baseline set")
+			iterSpan.End()
 			continue
 		}
 
-		if hwID != initialHdID {
+		diffs := fingerprint.Diff(baseline, fp)
+		switch fingerprint.Aggregate(diffs, deprovisionScore) {
+		case fingerprint.ActionDeprovision:
+			telemetry.HWIDMismatchTotal.Inc()
+			logChangedComponents(iterCtx, diffs)
+
+			approved, err := runChallenge(iterCtx, agentKey, baseline.CompositeID, fp.CompositeID, diffs, maxAttempts)
+			if err != nil {
+				logger.ErrorContext(iterCtx, "error running re-enrollment challenge", "error", err)
+				iterSpan.End()
+				continue
+			}
+			if approved {
+				logger.InfoContext(iterCtx, "controller approved hardware change; updating baseline")
+				baseline = fp
+				if err := fingerprint.SaveBaseline(componentsFile, fp); err != nil {
+					logger.ErrorContext(iterCtx, "error saving component baseline", "error", err)
+				}
+				break
+			}
+
 			authToken, err := loadAuthToken()
 			if err != nil {
-				log.Printf("Error loading auth token: %v", err)
+				logger.ErrorContext(iterCtx, "error loading auth token", "error", err)
+				iterSpan.End()
 				continue
 			}
 
-			if err := deprovisionDevice(authToken); err != nil {
-				log.Printf("Error deprovisioning device: %v", err)
+			if err := deprovisionDevice(iterCtx, authToken); err != nil {
+				logger.ErrorContext(iterCtx, "error deprovisioning device", "error", err)
+				iterSpan.End()
 				continue
 			}
 
-			log.Println("Device deprovisioned due to hardware changes.")
-			break
+			logger.InfoContext(iterCtx, "device deprovisioned due to hardware changes")
+			iterSpan.End()
+			return
+
+		case fingerprint.ActionWarn:
+			telemetry.HWIDMismatchTotal.Inc()
+			logChangedComponents(iterCtx, diffs)
+			baseline = fp
+			if err := fingerprint.SaveBaseline(componentsFile, fp); err != nil {
+				logger.ErrorContext(iterCtx, "error saving component baseline", "error", err)
+			}
+
+		default:
+			logger.InfoContext(iterCtx, "hardware configuration unchanged")
 		}
 
-		log.Println("Hardware configuration unchanged.")
+		iterSpan.End()
 		time.Sleep(time.Duration(period) * time.Second) // Periodic check interval
 	}
 }
+
+// logChangedComponents reports which components drifted and under
+// which policy, so an operator reading the log can tell a USB blip
+// from a CPU swap without digging into id/hw-components.json.
+func logChangedComponents(ctx context.Context, diffs []fingerprint.ComponentDiff) {
+	for _, d := range diffs {
+		if d.Changed {
+			logger.InfoContext(ctx, "hardware component changed", "component", d.Name, "policy", d.Policy, "weight", d.Weight)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/Datasance/EdgeGuard/internal/attest"
+)
+
+// runVerifier implements the `verify-attestation` subcommand used by the
+// controller (or an operator) to validate a reported envelope out of
+// band: go-binary verify-attestation <envelope.json> <nonce-hex> <ak-cert.pem> <roots.pem>
+func runVerifier(args []string) error {
+	if len(args) != 4 {
+		return fmt.Errorf("usage: verify-attestation <envelope.json> <nonce-hex> <ak-cert.pem> <roots.pem>")
+	}
+	envelopePath, nonceHex, akCertPath, rootsPath := args[0], args[1], args[2], args[3]
+
+	envelopeBytes, err := ioutil.ReadFile(envelopePath)
+	if err != nil {
+		return fmt.Errorf("failed to read envelope: %w", err)
+	}
+	var envelope attest.Envelope
+	if err := json.Unmarshal(envelopeBytes, &envelope); err != nil {
+		return fmt.Errorf("failed to parse envelope: %w", err)
+	}
+
+	nonce, err := hex.DecodeString(nonceHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode nonce: %w", err)
+	}
+
+	akCert, err := loadCert(akCertPath)
+	if err != nil {
+		return fmt.Errorf("failed to load AK certificate: %w", err)
+	}
+
+	roots, err := loadCertPool(rootsPath)
+	if err != nil {
+		return fmt.Errorf("failed to load trusted roots: %w", err)
+	}
+
+	if err := attest.VerifyEnvelope(&envelope, nonce, akCert, roots); err != nil {
+		return err
+	}
+
+	fmt.Printf("attestation OK for hwid %s\n", envelope.HWID)
+	return nil
+}
+
+func loadCert(path string) (*x509.Certificate, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
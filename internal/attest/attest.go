@@ -0,0 +1,188 @@
+// Package attest wraps the TPM 2.0 operations EdgeGuard needs to prove
+// hardware identity to the controller: loading (or creating) a
+// persistent attestation key (AK), extending a PCR with a measurement of
+// the collected hardware data, and producing a signed quote over that
+// PCR for the controller to verify.
+//
+// It is built against github.com/google/go-tpm/legacy/tpm2, the
+// free-function API preserved for callers who haven't migrated to the
+// newer command-object API in github.com/google/go-tpm/tpm2.
+package attest
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+)
+
+const (
+	// PCRIndex is the PCR EdgeGuard extends with the hardware-data
+	// digest. 16-23 are the "debug" PCRs most TPMs leave free for
+	// application use, and 16 (along with 23) is also one of the few
+	// PCRs a caller is allowed to reset, which ExtendHardwareDigest
+	// relies on.
+	PCRIndex = 16
+
+	akHandleFile = "id/ak-handle"
+	akPubFile    = "id/ak-pub"
+
+	// persistentAKHandle is where the AK is evicted to once created, so
+	// it survives across the TPM connections each poll iteration opens
+	// and closes. A CreatePrimary handle is transient: it's flushed by
+	// the resource manager as soon as that connection closes, so
+	// persisting only the handle *number* (as opposed to the object
+	// itself) would leave every later iteration handing a dead handle
+	// to the TPM.
+	persistentAKHandle tpmutil.Handle = 0x81010002
+)
+
+// akTemplateRSA is the public area template for a restricted RSA signing
+// key under the endorsement hierarchy, suitable for use as an AK: it can
+// only sign data the TPM itself produced (quotes, certify structures),
+// never arbitrary caller-supplied data.
+var akTemplateRSA = tpm2.Public{
+	Type:       tpm2.AlgRSA,
+	NameAlg:    tpm2.AlgSHA256,
+	Attributes: tpm2.FlagSign | tpm2.FlagRestricted | tpm2.FlagFixedTPM | tpm2.FlagFixedParent | tpm2.FlagSensitiveDataOrigin | tpm2.FlagUserWithAuth,
+	RSAParameters: &tpm2.RSAParams{
+		Sign: &tpm2.SigScheme{
+			Alg:  tpm2.AlgRSASSA,
+			Hash: tpm2.AlgSHA256,
+		},
+		KeyBits: 2048,
+	},
+}
+
+// AK identifies a loaded attestation key: its persistent handle and its
+// public area, both of which are persisted to disk so EdgeGuard doesn't
+// re-create (and re-enroll) a new key on every restart.
+type AK struct {
+	Handle tpmutil.Handle
+	Public []byte
+}
+
+// LoadOrCreateAK loads the AK persisted under id/ak-handle, or creates a
+// fresh one under the endorsement hierarchy and persists it if none
+// exists yet. The returned Public blob is what gets shipped to the
+// controller during enrollment so it can verify future quotes.
+//
+// The AK itself is evicted to persistentAKHandle so it remains loaded
+// in the TPM across the separate connections each poll iteration opens;
+// id/ak-handle records the same constant rather than a transient handle
+// that would already be dead by the time it's read back.
+func LoadOrCreateAK(rwc io.ReadWriteCloser) (*AK, error) {
+	if handle, pub, err := loadAK(); err == nil {
+		return &AK{Handle: handle, Public: pub}, nil
+	}
+
+	handle, pub, err := createAK(rwc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AK: %w", err)
+	}
+	if err := saveAK(handle, pub); err != nil {
+		return nil, fmt.Errorf("failed to persist AK: %w", err)
+	}
+	return &AK{Handle: handle, Public: pub}, nil
+}
+
+func createAK(rwc io.ReadWriteCloser) (tpmutil.Handle, []byte, error) {
+	transientHandle, _, err := tpm2.CreatePrimary(rwc, tpm2.HandleEndorsement, tpm2.PCRSelection{}, "", "", akTemplateRSA)
+	if err != nil {
+		return 0, nil, fmt.Errorf("CreatePrimary(AK): %w", err)
+	}
+	defer tpm2.FlushContext(rwc, transientHandle)
+
+	if err := tpm2.EvictControl(rwc, "", tpm2.HandleOwner, transientHandle, persistentAKHandle); err != nil {
+		return 0, nil, fmt.Errorf("EvictControl(AK): %w", err)
+	}
+
+	pub, _, _, err := tpm2.ReadPublic(rwc, persistentAKHandle)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ReadPublic(AK): %w", err)
+	}
+	pubBytes, err := pub.Encode()
+	if err != nil {
+		return 0, nil, fmt.Errorf("encode AK public area: %w", err)
+	}
+
+	return persistentAKHandle, pubBytes, nil
+}
+
+func loadAK() (tpmutil.Handle, []byte, error) {
+	pub, err := os.ReadFile(akPubFile)
+	if err != nil {
+		return 0, nil, err
+	}
+	raw, err := os.ReadFile(akHandleFile)
+	if err != nil {
+		return 0, nil, err
+	}
+	var handle tpmutil.Handle
+	if _, err := fmt.Sscanf(string(raw), "%d", &handle); err != nil {
+		return 0, nil, fmt.Errorf("parse persisted AK handle: %w", err)
+	}
+	return handle, pub, nil
+}
+
+func saveAK(handle tpmutil.Handle, pub []byte) error {
+	if err := os.WriteFile(akHandleFile, []byte(fmt.Sprintf("%d", handle)), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(akPubFile, pub, 0600)
+}
+
+// ExtendHardwareDigest resets PCRIndex and extends it once with the
+// SHA-256 digest of the marshalled hardware data, so the quote below
+// attests to exactly the reading the agent reported: the PCR's value
+// after this call is always SHA256(0x00*32 || SHA256(hardwareJSON)),
+// independent of any prior iteration's measurement. That lets a
+// stateless verifier recompute the expected PCR value straight from a
+// reported hardware reading instead of needing an ever-growing hash
+// chain it has no way to reconstruct.
+func ExtendHardwareDigest(rwc io.ReadWriteCloser, hardwareJSON []byte) error {
+	if err := tpm2.PCRReset(rwc, tpmutil.Handle(PCRIndex)); err != nil {
+		return fmt.Errorf("reset PCR %d: %w", PCRIndex, err)
+	}
+	digest := sha256.Sum256(hardwareJSON)
+	return tpm2.PCRExtend(rwc, tpmutil.Handle(PCRIndex), tpm2.AlgSHA256, digest[:], "")
+}
+
+// Quote is the signed evidence sent to the controller alongside the
+// salted hash: the PCR values it covers, the raw quote structure, and
+// the signature over it.
+type Quote struct {
+	PCRValues map[int][]byte
+	Attested  []byte
+	Signature []byte
+}
+
+// GenerateQuote asks the TPM to quote PCRIndex under ak, binding the
+// controller-supplied nonce so the quote can't be replayed against a
+// different challenge.
+func GenerateQuote(rwc io.ReadWriteCloser, ak *AK, nonce []byte) (*Quote, error) {
+	sel := tpm2.PCRSelection{Hash: tpm2.AlgSHA256, PCRs: []int{PCRIndex}}
+
+	attested, sig, err := tpm2.Quote(rwc, ak.Handle, "", "", nonce, sel, tpm2.AlgNull)
+	if err != nil {
+		return nil, fmt.Errorf("tpm2.Quote: %w", err)
+	}
+	sigBytes, err := sig.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("encode quote signature: %w", err)
+	}
+
+	pcrValues, err := tpm2.ReadPCRs(rwc, sel)
+	if err != nil {
+		return nil, fmt.Errorf("ReadPCRs: %w", err)
+	}
+
+	return &Quote{
+		PCRValues: pcrValues,
+		Attested:  attested,
+		Signature: sigBytes,
+	}, nil
+}
@@ -0,0 +1,34 @@
+package attest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+)
+
+// rsaOrECDSAVerify verifies the TPMT_SIGNATURE sig (decoded from the
+// quote's raw signature bytes) over hashed against pub, dispatching on
+// the concrete key type since an AK template can be either RSA or ECDSA
+// depending on what the TPM supports.
+func rsaOrECDSAVerify(pub crypto.PublicKey, hashed []byte, sig *tpm2.Signature) error {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		if sig.RSA == nil {
+			return fmt.Errorf("expected an RSA signature, quote carried none")
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed, sig.RSA.Signature)
+	case *ecdsa.PublicKey:
+		if sig.ECC == nil {
+			return fmt.Errorf("expected an ECDSA signature, quote carried none")
+		}
+		if !ecdsa.Verify(key, hashed, sig.ECC.R, sig.ECC.S) {
+			return fmt.Errorf("ECDSA signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported AK public key type %T", pub)
+	}
+}
@@ -0,0 +1,141 @@
+package attest
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/google/go-tpm/legacy/tpm2"
+)
+
+// Envelope is what the agent POSTs to /v2/attest. It carries the salted
+// hash the controller already understands, the raw hardware reading
+// that hash (and the PCR measurement) were computed from, and the TPM
+// evidence that backs it.
+type Envelope struct {
+	HWID         string         `json:"hwid"`
+	HardwareData []byte         `json:"hardware_data"`
+	PCRValues    map[int][]byte `json:"pcr_values"`
+	Quote        []byte         `json:"quote"`
+	Signature    []byte         `json:"signature"`
+	AKPub        []byte         `json:"ak_pub"`
+}
+
+// VerifyEnvelope checks that env.Quote is a genuine TPM2B_ATTEST signed
+// by the key in env.AKPub over nonce, that the attested PCR digest
+// matches env.PCRValues, that PCRIndex's reported value is exactly what
+// ExtendHardwareDigest would have produced from env.HardwareData, and
+// that akCert chains up to root. A reported HWID must not be accepted
+// unless this returns nil: without the HardwareData/PCR cross-check, a
+// compromised agent could pair any genuine (but unrelated) quote with a
+// forged HWID and have it accepted.
+func VerifyEnvelope(env *Envelope, nonce []byte, akCert *x509.Certificate, roots *x509.CertPool) error {
+	if _, err := akCert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); err != nil {
+		return fmt.Errorf("AK certificate does not chain to a trusted root: %w", err)
+	}
+
+	pub, err := tpm2.DecodePublic(env.AKPub)
+	if err != nil {
+		return fmt.Errorf("decode AK public area: %w", err)
+	}
+
+	akKey, err := pub.Key()
+	if err != nil {
+		return fmt.Errorf("extract AK public key: %w", err)
+	}
+	if !publicKeysEqual(akKey, akCert.PublicKey) {
+		return fmt.Errorf("env.ak_pub does not match the key certified by akCert")
+	}
+
+	if err := verifySignature(pub, env.Quote, env.Signature); err != nil {
+		return fmt.Errorf("quote signature invalid: %w", err)
+	}
+
+	attestData, err := tpm2.DecodeAttestationData(env.Quote)
+	if err != nil {
+		return fmt.Errorf("decode attestation data: %w", err)
+	}
+	if !bytes.Equal(attestData.ExtraData, nonce) {
+		return fmt.Errorf("quote nonce does not match the challenge sent to the agent")
+	}
+	if attestData.AttestedQuoteInfo == nil {
+		return fmt.Errorf("attestation data is missing PCR quote info")
+	}
+
+	wantDigest := pcrDigest(env.PCRValues)
+	if !bytes.Equal(attestData.AttestedQuoteInfo.PCRDigest, wantDigest) {
+		return fmt.Errorf("quoted PCR digest does not match reported PCR values")
+	}
+
+	gotPCR, ok := env.PCRValues[PCRIndex]
+	if !ok {
+		return fmt.Errorf("envelope is missing PCR %d, the hardware-measurement PCR", PCRIndex)
+	}
+	if !bytes.Equal(gotPCR, expectedHardwarePCR(env.HardwareData)) {
+		return fmt.Errorf("PCR %d does not match SHA256(0 || SHA256(hardware_data)): reported hardware data was not what was attested", PCRIndex)
+	}
+
+	return nil
+}
+
+// expectedHardwarePCR recomputes the value PCRIndex must hold after
+// ExtendHardwareDigest(hardwareData): a reset PCR (all zero) extended
+// once with SHA256(hardwareData).
+func expectedHardwarePCR(hardwareData []byte) []byte {
+	eventDigest := sha256.Sum256(hardwareData)
+	var reset [sha256.Size]byte
+	extended := sha256.Sum256(append(reset[:], eventDigest[:]...))
+	return extended[:]
+}
+
+// publicKeysEqual reports whether a and b are the same RSA or ECDSA
+// public key. It is used to bind the AK blob inside the envelope (fully
+// attacker-controlled, like everything else in it) to the key akCert
+// actually certifies, so a compromised agent can't just generate its own
+// keypair, self-sign a quote, and submit it alongside any valid-looking
+// cert file.
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	switch ak := a.(type) {
+	case *rsa.PublicKey:
+		bk, ok := b.(*rsa.PublicKey)
+		return ok && ak.E == bk.E && ak.N.Cmp(bk.N) == 0
+	case *ecdsa.PublicKey:
+		bk, ok := b.(*ecdsa.PublicKey)
+		return ok && ak.Curve == bk.Curve && ak.X.Cmp(bk.X) == 0 && ak.Y.Cmp(bk.Y) == 0
+	default:
+		return false
+	}
+}
+
+func verifySignature(pub tpm2.Public, quote, sigBytes []byte) error {
+	key, err := pub.Key()
+	if err != nil {
+		return fmt.Errorf("extract verification key: %w", err)
+	}
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(sigBytes))
+	if err != nil {
+		return fmt.Errorf("decode quote signature: %w", err)
+	}
+	hashed := hashAttested(quote)
+	return rsaOrECDSAVerify(key, hashed, sig)
+}
+
+func hashAttested(quote []byte) []byte {
+	h := crypto.SHA256.New()
+	h.Write(quote)
+	return h.Sum(nil)
+}
+
+func pcrDigest(pcrValues map[int][]byte) []byte {
+	h := crypto.SHA256.New()
+	for i := 0; i < 24; i++ {
+		if v, ok := pcrValues[i]; ok {
+			h.Write(v)
+		}
+	}
+	return h.Sum(nil)
+}
@@ -0,0 +1,16 @@
+package challenge
+
+import "time"
+
+// Backoff returns the exponential backoff delay for the given attempt
+// (0-indexed), doubling from base and capped at max.
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
@@ -0,0 +1,29 @@
+package challenge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	base := time.Second
+	max := 10 * time.Second
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, max}, // would be 16s, capped
+		{10, max},
+	}
+
+	for _, tc := range tests {
+		if got := Backoff(tc.attempt, base, max); got != tc.want {
+			t.Errorf("Backoff(%d, %v, %v) = %v, want %v", tc.attempt, base, max, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package challenge implements EdgeGuard's signed re-enrollment flow:
+// instead of deprovisioning the instant a hardware fingerprint changes,
+// the agent asks the controller what to do with the change, signing the
+// request so the controller knows it actually came from this device's
+// agent key.
+package challenge
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Datasance/EdgeGuard/internal/fingerprint"
+)
+
+// Decision is the controller's verdict on a reported hardware change.
+type Decision string
+
+const (
+	// DecisionApprove accepts the new hardware ID as the baseline.
+	DecisionApprove Decision = "approve"
+	// DecisionConfirm means an operator still needs to approve the
+	// change out of band; the agent should back off and retry.
+	DecisionConfirm Decision = "confirm"
+	// DecisionReject means the change is not sanctioned; the agent
+	// should proceed to deprovision.
+	DecisionReject Decision = "reject"
+)
+
+// Request is the signed envelope POSTed to the controller.
+type Request struct {
+	OldHWID   string                      `json:"old_hwid"`
+	NewHWID   string                      `json:"new_hwid"`
+	Diff      []fingerprint.ComponentDiff `json:"diff"`
+	Signature []byte                      `json:"signature"`
+	PublicKey ed25519.PublicKey           `json:"public_key"`
+}
+
+// Response is the controller's reply to a Request.
+type Response struct {
+	Decision Decision `json:"decision"`
+}
+
+// LoadOrCreateKey loads the Ed25519 key persisted at path, generating
+// and persisting a new one if none exists. The same key must be reused
+// across restarts so the controller can recognize this agent across
+// challenges.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	if raw, err := os.ReadFile(path); err == nil {
+		if len(raw) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("agent key at %s has unexpected length %d", path, len(raw))
+		}
+		return ed25519.PrivateKey(raw), nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate agent key: %w", err)
+	}
+	if err := os.WriteFile(path, priv, 0600); err != nil {
+		return nil, fmt.Errorf("failed to persist agent key: %w", err)
+	}
+	return priv, nil
+}
+
+// signingPayload is the subset of Request that gets signed; it excludes
+// Signature itself.
+func signingPayload(oldHWID, newHWID string, diff []fingerprint.ComponentDiff) ([]byte, error) {
+	return json.Marshal(struct {
+		OldHWID string                      `json:"old_hwid"`
+		NewHWID string                      `json:"new_hwid"`
+		Diff    []fingerprint.ComponentDiff `json:"diff"`
+	}{oldHWID, newHWID, diff})
+}
+
+// NewRequest builds and signs a re-enrollment request with priv.
+func NewRequest(priv ed25519.PrivateKey, oldHWID, newHWID string, diff []fingerprint.ComponentDiff) (*Request, error) {
+	payload, err := signingPayload(oldHWID, newHWID, diff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build challenge payload: %w", err)
+	}
+
+	return &Request{
+		OldHWID:   oldHWID,
+		NewHWID:   newHWID,
+		Diff:      diff,
+		Signature: ed25519.Sign(priv, payload),
+		PublicKey: priv.Public().(ed25519.PublicKey),
+	}, nil
+}
+
+// Post sends req to the controller's /v2/hwid-challenge endpoint and
+// returns its decision.
+func Post(url string, req *Request) (*Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize challenge request: %w", err)
+	}
+
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to POST challenge request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("controller rejected challenge request: status %d", resp.StatusCode)
+	}
+
+	var decision Response
+	if err := json.NewDecoder(resp.Body).Decode(&decision); err != nil {
+		return nil, fmt.Errorf("failed to decode challenge response: %w", err)
+	}
+	return &decision, nil
+}
@@ -0,0 +1,72 @@
+package fingerprint
+
+// ComponentDiff reports whether one component changed between a stored
+// baseline and a current reading, and the policy that applies to it.
+type ComponentDiff struct {
+	Name    string `json:"name"`
+	Changed bool   `json:"changed"`
+	Weight  int    `json:"weight"`
+	Policy  string `json:"policy"`
+}
+
+// Diff compares two Fingerprints component by component. Components
+// present in current but missing from baseline (e.g. the baseline
+// predates this agent version) are reported as changed so new
+// components aren't silently trusted.
+func Diff(baseline, current *Fingerprint) []ComponentDiff {
+	baseByName := make(map[string]Component, len(baseline.Components))
+	for _, c := range baseline.Components {
+		baseByName[c.Name] = c
+	}
+
+	diffs := make([]ComponentDiff, 0, len(current.Components))
+	for _, c := range current.Components {
+		base, ok := baseByName[c.Name]
+		diffs = append(diffs, ComponentDiff{
+			Name:    c.Name,
+			Changed: !ok || base.Hash != c.Hash,
+			Weight:  c.Weight,
+			Policy:  c.Policy,
+		})
+	}
+	return diffs
+}
+
+// Action is the outcome of aggregating a diff's policy scores:
+// deprovision wins over warn, which wins over none.
+type Action string
+
+const (
+	ActionNone        Action = "none"
+	ActionWarn        Action = "warn"
+	ActionDeprovision Action = "deprovision"
+)
+
+// Score sums the Weight of every changed component whose Policy is
+// "deprovision". Aggregate returns ActionDeprovision once that score
+// exceeds threshold, ActionWarn if any changed component only warns,
+// and ActionNone otherwise — so a weight-0 USB/PCI component can
+// never trigger deprovisioning on its own.
+func Score(diffs []ComponentDiff) int {
+	score := 0
+	for _, d := range diffs {
+		if d.Changed && d.Policy == string(ActionDeprovision) {
+			score += d.Weight
+		}
+	}
+	return score
+}
+
+// Aggregate decides what the agent should do about a diff, given the
+// deprovision-score threshold.
+func Aggregate(diffs []ComponentDiff, threshold int) Action {
+	if Score(diffs) > threshold {
+		return ActionDeprovision
+	}
+	for _, d := range diffs {
+		if d.Changed && d.Policy == string(ActionWarn) {
+			return ActionWarn
+		}
+	}
+	return ActionNone
+}
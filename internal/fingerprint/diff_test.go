@@ -0,0 +1,154 @@
+package fingerprint
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	baseline := &Fingerprint{Components: []Component{
+		{Name: "cpu", Weight: 40, Hash: "aaa", Policy: "deprovision"},
+		{Name: "usb", Weight: 0, Hash: "bbb", Policy: "warn"},
+	}}
+
+	tests := []struct {
+		name    string
+		current *Fingerprint
+		want    map[string]bool // component name -> expected Changed
+	}{
+		{
+			name: "no changes",
+			current: &Fingerprint{Components: []Component{
+				{Name: "cpu", Weight: 40, Hash: "aaa", Policy: "deprovision"},
+				{Name: "usb", Weight: 0, Hash: "bbb", Policy: "warn"},
+			}},
+			want: map[string]bool{"cpu": false, "usb": false},
+		},
+		{
+			name: "one component drifted",
+			current: &Fingerprint{Components: []Component{
+				{Name: "cpu", Weight: 40, Hash: "ccc", Policy: "deprovision"},
+				{Name: "usb", Weight: 0, Hash: "bbb", Policy: "warn"},
+			}},
+			want: map[string]bool{"cpu": true, "usb": false},
+		},
+		{
+			name: "new component not in baseline is reported as changed",
+			current: &Fingerprint{Components: []Component{
+				{Name: "cpu", Weight: 40, Hash: "aaa", Policy: "deprovision"},
+				{Name: "pci", Weight: 0, Hash: "ddd", Policy: "warn"},
+			}},
+			want: map[string]bool{"cpu": false, "pci": true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			diffs := Diff(baseline, tc.current)
+			if len(diffs) != len(tc.want) {
+				t.Fatalf("got %d diffs, want %d", len(diffs), len(tc.want))
+			}
+			for _, d := range diffs {
+				want, ok := tc.want[d.Name]
+				if !ok {
+					t.Fatalf("unexpected component %q in diff", d.Name)
+				}
+				if d.Changed != want {
+					t.Errorf("component %q: got Changed=%v, want %v", d.Name, d.Changed, want)
+				}
+			}
+		})
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		name  string
+		diffs []ComponentDiff
+		want  int
+	}{
+		{
+			name:  "no diffs",
+			diffs: nil,
+			want:  0,
+		},
+		{
+			name: "unchanged deprovision component doesn't score",
+			diffs: []ComponentDiff{
+				{Name: "cpu", Changed: false, Weight: 40, Policy: "deprovision"},
+			},
+			want: 0,
+		},
+		{
+			name: "changed warn component doesn't score",
+			diffs: []ComponentDiff{
+				{Name: "usb", Changed: true, Weight: 0, Policy: "warn"},
+			},
+			want: 0,
+		},
+		{
+			name: "changed deprovision components sum their weight",
+			diffs: []ComponentDiff{
+				{Name: "cpu", Changed: true, Weight: 40, Policy: "deprovision"},
+				{Name: "board", Changed: true, Weight: 25, Policy: "deprovision"},
+				{Name: "mac", Changed: true, Weight: 10, Policy: "warn"},
+			},
+			want: 65,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Score(tc.diffs); got != tc.want {
+				t.Errorf("Score() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name      string
+		diffs     []ComponentDiff
+		threshold int
+		want      Action
+	}{
+		{
+			name:      "nothing changed",
+			diffs:     []ComponentDiff{{Name: "cpu", Changed: false, Weight: 40, Policy: "deprovision"}},
+			threshold: 0,
+			want:      ActionNone,
+		},
+		{
+			name:      "warn-only change",
+			diffs:     []ComponentDiff{{Name: "mac", Changed: true, Weight: 10, Policy: "warn"}},
+			threshold: 0,
+			want:      ActionWarn,
+		},
+		{
+			name:      "deprovision score exceeds threshold",
+			diffs:     []ComponentDiff{{Name: "cpu", Changed: true, Weight: 40, Policy: "deprovision"}},
+			threshold: 0,
+			want:      ActionDeprovision,
+		},
+		{
+			name:      "deprovision score at threshold doesn't trigger",
+			diffs:     []ComponentDiff{{Name: "cpu", Changed: true, Weight: 40, Policy: "deprovision"}},
+			threshold: 40,
+			want:      ActionNone,
+		},
+		{
+			name: "weight-0 component can never trigger deprovision",
+			diffs: []ComponentDiff{
+				{Name: "usb", Changed: true, Weight: 0, Policy: "deprovision"},
+			},
+			threshold: 0,
+			want:      ActionNone,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Aggregate(tc.diffs, tc.threshold); got != tc.want {
+				t.Errorf("Aggregate() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+// Package fingerprint computes a weighted, per-component hardware
+// fingerprint instead of a single monolithic hash. Hashing CPU, board,
+// MAC, disk, and memory readings separately lets the agent tell "a USB
+// stick was plugged in" apart from "the CPU was swapped" and react to
+// each according to its own TOLERANCE policy, instead of deprovisioning
+// on any byte of drift in the combined HAL output.
+package fingerprint
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Datasance/EdgeGuard/collector"
+	"github.com/Datasance/EdgeGuard/internal/telemetry"
+)
+
+// Component is one independently-hashed slice of the hardware reading.
+type Component struct {
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+	Hash   string `json:"hash"`
+	Policy string `json:"policy"`
+}
+
+// Fingerprint is the full weighted reading: every component plus a
+// composite ID (the hash of the component hashes) used wherever the
+// agent previously used the single salted hash.
+type Fingerprint struct {
+	Components  []Component `json:"components"`
+	CompositeID string      `json:"composite_id"`
+}
+
+type componentSpec struct {
+	name   string
+	weight int
+	value  interface{}
+}
+
+// componentWeights is the single source of truth for each component's
+// deprovision-score weight, shared with ParseTolerance so it can reject
+// a "deprovision" policy for a component that can never carry one.
+var componentWeights = map[string]int{
+	"cpu":    40,
+	"board":  25,
+	"mac":    10,
+	"disk":   15,
+	"memory": 10,
+	"usb":    0,
+	"pci":    0,
+}
+
+// Compute builds a Fingerprint from a HardwareData reading, salting
+// each component hash the same way the old calculateSaltedHash salted
+// its single hash, and resolving each component's policy from
+// tolerance (see ParseTolerance).
+func Compute(ctx context.Context, data *collector.HardwareData, salt string, tolerance map[string]string) (*Fingerprint, error) {
+	_, span := telemetry.Tracer.Start(ctx, "fingerprint.Compute")
+	defer span.End()
+
+	fp := &Fingerprint{}
+	var compositeInput []byte
+
+	for _, spec := range componentSpecs(data) {
+		h, err := hashComponent(salt, spec.value)
+		if err != nil {
+			return nil, fmt.Errorf("hash component %s: %w", spec.name, err)
+		}
+		policy := tolerance[spec.name]
+		if policy == "" {
+			policy = defaultPolicy(spec.name)
+		}
+		fp.Components = append(fp.Components, Component{
+			Name:   spec.name,
+			Weight: spec.weight,
+			Hash:   h,
+			Policy: policy,
+		})
+		compositeInput = append(compositeInput, []byte(h)...)
+	}
+
+	compositeHash := sha256.Sum256(compositeInput)
+	fp.CompositeID = fmt.Sprintf("%x", compositeHash)
+	return fp, nil
+}
+
+// componentSpecs carves the seven components (five weighted, plus the
+// zero-weight usb and pci) out of the raw HAL reading. lshw's output nests system/network/disk/memory sections
+// under those keys when present; if HAL didn't report a section
+// (common on stripped-down images) we fall back to hashing the whole
+// lshw blob for that component rather than failing the read outright.
+func componentSpecs(data *collector.HardwareData) []componentSpec {
+	return []componentSpec{
+		{name: "cpu", weight: componentWeights["cpu"], value: merge(data.Lscpu, data.CpuInfo)},
+		{name: "board", weight: componentWeights["board"], value: section(data.Lshw, "system", "board")},
+		{name: "mac", weight: componentWeights["mac"], value: section(data.Lshw, "network", "interfaces")},
+		{name: "disk", weight: componentWeights["disk"], value: section(data.Lshw, "disk", "storage")},
+		{name: "memory", weight: componentWeights["memory"], value: section(data.Lshw, "memory")},
+		{name: "usb", weight: componentWeights["usb"], value: data.Lsusb},
+		{name: "pci", weight: componentWeights["pci"], value: data.Lspci},
+	}
+}
+
+func section(lshw map[string]interface{}, keys ...string) interface{} {
+	for _, key := range keys {
+		if v, ok := lshw[key]; ok {
+			return v
+		}
+	}
+	return lshw
+}
+
+func merge(maps ...map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func hashComponent(salt string, value interface{}) (string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("serialize component: %w", err)
+	}
+	salted := append([]byte(salt), raw...)
+	sum := sha256.Sum256(salted)
+	return fmt.Sprintf("%x", sum), nil
+}
+
+// defaultPolicy is used when TOLERANCE doesn't mention a component.
+// CPU and board swaps are treated as re-provisioning events by default;
+// everything else only warns, so an unconfigured agent never
+// deprovisions itself over USB/PCI churn.
+func defaultPolicy(name string) string {
+	switch name {
+	case "cpu", "board":
+		return "deprovision"
+	default:
+		return "warn"
+	}
+}
@@ -0,0 +1,34 @@
+package fingerprint
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// LoadBaseline reads the per-component baseline persisted at path (e.g.
+// id/hw-components.json). A missing file is not an error: it just means
+// no baseline has been recorded yet, so the caller should treat the
+// first reading as authoritative.
+func LoadBaseline(path string) (*Fingerprint, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var fp Fingerprint
+	if err := json.Unmarshal(raw, &fp); err != nil {
+		return nil, err
+	}
+	return &fp, nil
+}
+
+// SaveBaseline persists fp to path as the new baseline.
+func SaveBaseline(path string, fp *Fingerprint) error {
+	raw, err := json.MarshalIndent(fp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0600)
+}
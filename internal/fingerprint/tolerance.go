@@ -0,0 +1,65 @@
+package fingerprint
+
+import (
+	"fmt"
+	"strings"
+)
+
+// validPolicies are the only actions a TOLERANCE entry may name.
+var validPolicies = map[string]bool{"ignore": true, "warn": true, "deprovision": true}
+
+// componentAliases maps the human-friendly TOLERANCE keys (e.g.
+// "usb_changes", "cpu_change") onto the Component.Name they govern.
+var componentAliases = map[string]string{
+	"usb_changes":    "usb",
+	"pci_changes":    "pci",
+	"cpu_change":     "cpu",
+	"cpu_changes":    "cpu",
+	"board_change":   "board",
+	"board_changes":  "board",
+	"mac_change":     "mac",
+	"mac_changes":    "mac",
+	"disk_change":    "disk",
+	"disk_changes":   "disk",
+	"memory_change":  "memory",
+	"memory_changes": "memory",
+}
+
+// ParseTolerance parses a TOLERANCE string such as
+// "usb_changes=ignore,pci_changes=warn,cpu_change=deprovision" into a
+// map keyed by Component.Name. An empty string is valid and yields an
+// empty map, letting every component fall back to defaultPolicy.
+func ParseTolerance(raw string) (map[string]string, error) {
+	policy := map[string]string{}
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return policy, nil
+	}
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid TOLERANCE entry %q: want key=policy", entry)
+		}
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		component, ok := componentAliases[key]
+		if !ok {
+			component = key // allow addressing a Component.Name directly
+		}
+		if !validPolicies[value] {
+			return nil, fmt.Errorf("invalid TOLERANCE policy %q for %q: must be ignore, warn, or deprovision", value, key)
+		}
+		if value == "deprovision" && componentWeights[component] == 0 {
+			return nil, fmt.Errorf("invalid TOLERANCE policy for %q: %q carries no deprovision weight, so it can never trigger deprovisioning; use warn or ignore instead", key, component)
+		}
+		policy[component] = value
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,81 @@
+package fingerprint
+
+import "testing"
+
+func TestParseTolerance(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "empty string yields empty map",
+			raw:  "",
+			want: map[string]string{},
+		},
+		{
+			name: "aliases resolve to component names",
+			raw:  "usb_changes=ignore,pci_changes=warn,cpu_change=deprovision",
+			want: map[string]string{"usb": "ignore", "pci": "warn", "cpu": "deprovision"},
+		},
+		{
+			name: "whitespace around entries and keys is trimmed",
+			raw:  " mac_changes = warn , disk_change=ignore ",
+			want: map[string]string{"mac": "warn", "disk": "ignore"},
+		},
+		{
+			name: "unrecognized key is treated as a literal component name",
+			raw:  "memory=warn",
+			want: map[string]string{"memory": "warn"},
+		},
+		{
+			name:    "malformed entry without =",
+			raw:     "cpu_change",
+			wantErr: true,
+		},
+		{
+			name:    "invalid policy",
+			raw:     "cpu_change=reboot",
+			wantErr: true,
+		},
+		{
+			name:    "deprovision on a weight-0 component is rejected",
+			raw:     "usb_changes=deprovision",
+			wantErr: true,
+		},
+		{
+			name:    "deprovision on pci is rejected the same way",
+			raw:     "pci_changes=deprovision",
+			wantErr: true,
+		},
+		{
+			name: "deprovision on a weighted component is accepted",
+			raw:  "mac_changes=deprovision",
+			want: map[string]string{"mac": "deprovision"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseTolerance(tc.raw)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTolerance(%q) = nil error, want one", tc.raw)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTolerance(%q) returned unexpected error: %v", tc.raw, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("ParseTolerance(%q) = %v, want %v", tc.raw, got, tc.want)
+			}
+			for k, v := range tc.want {
+				if got[k] != v {
+					t.Errorf("ParseTolerance(%q)[%q] = %q, want %q", tc.raw, k, got[k], v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+// Package resilience provides the retry and circuit-breaker building
+// blocks EdgeGuard's HAL client uses so a hung or flaky sidecar can't
+// freeze or busy-loop the agent.
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// State is one of a Breaker's three states.
+type State int
+
+const (
+	// Closed: calls go through normally.
+	Closed State = iota
+	// Open: calls are short-circuited until Cooldown elapses.
+	Open
+	// HalfOpen: a single trial call is allowed through to test
+	// whether the downstream has recovered.
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Breaker trips to Open after Threshold consecutive failures and stays
+// there for Cooldown before allowing a single HalfOpen trial call.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+	OnChange  func(from, to State)
+
+	mu              sync.Mutex
+	state           State
+	consecutiveFail int
+	openedAt        time.Time
+}
+
+// NewBreaker returns a Breaker that opens after threshold consecutive
+// failures and stays open for cooldown. onChange, if non-nil, is called
+// on every state transition for logging.
+func NewBreaker(threshold int, cooldown time.Duration, onChange func(from, to State)) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown, OnChange: onChange}
+}
+
+// Allow reports whether a call should be attempted. Calling it while
+// the breaker is Open and past its cooldown transitions it to HalfOpen
+// and allows exactly that one trial call through.
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		// The trial call is already in flight; hold everything else
+		// back until it records its outcome.
+		return false
+	case Open:
+		if time.Since(b.openedAt) >= b.Cooldown {
+			b.transition(HalfOpen)
+			return true
+		}
+		return false
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the breaker and resets its failure count.
+func (b *Breaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consecutiveFail = 0
+	if b.state != Closed {
+		b.transition(Closed)
+	}
+}
+
+// RecordFailure counts a failure and opens the breaker once Threshold
+// consecutive failures have been recorded (or immediately, if the
+// failing call was the HalfOpen trial).
+func (b *Breaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen {
+		b.transition(Open)
+		return
+	}
+
+	b.consecutiveFail++
+	if b.consecutiveFail >= b.Threshold {
+		b.transition(Open)
+	}
+}
+
+// transition must be called with b.mu held.
+func (b *Breaker) transition(to State) {
+	from := b.state
+	b.state = to
+	if to == Open {
+		b.openedAt = time.Now()
+	}
+	if from != to && b.OnChange != nil {
+		b.OnChange(from, to)
+	}
+}
@@ -0,0 +1,99 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	var transitions []State
+	b := NewBreaker(3, time.Hour, func(from, to State) {
+		transitions = append(transitions, to)
+	})
+
+	for i := 0; i < 2; i++ {
+		if !b.Allow() {
+			t.Fatalf("Allow() = false before threshold reached")
+		}
+		b.RecordFailure()
+	}
+	if b.state != Closed {
+		t.Fatalf("breaker state = %v, want Closed before threshold reached", b.state)
+	}
+
+	b.RecordFailure() // 3rd consecutive failure trips it
+	if b.state != Open {
+		t.Fatalf("breaker state = %v, want Open after threshold reached", b.state)
+	}
+	if b.Allow() {
+		t.Fatalf("Allow() = true while Open and before cooldown")
+	}
+	if len(transitions) != 1 || transitions[0] != Open {
+		t.Fatalf("transitions = %v, want [Open]", transitions)
+	}
+}
+
+func TestBreakerHalfOpenAfterCooldown(t *testing.T) {
+	b := NewBreaker(1, 10*time.Millisecond, nil)
+
+	b.RecordFailure() // trips open
+	if b.state != Open {
+		t.Fatalf("breaker state = %v, want Open", b.state)
+	}
+
+	time.Sleep(15 * time.Millisecond)
+	if !b.Allow() {
+		t.Fatalf("Allow() = false after cooldown elapsed")
+	}
+	if b.state != HalfOpen {
+		t.Fatalf("breaker state = %v, want HalfOpen after cooldown trial", b.state)
+	}
+}
+
+func TestBreakerHalfOpenFailureReopens(t *testing.T) {
+	b := NewBreaker(1, 10*time.Millisecond, nil)
+	b.RecordFailure()
+	time.Sleep(15 * time.Millisecond)
+	b.Allow() // transitions to HalfOpen
+
+	b.RecordFailure()
+	if b.state != Open {
+		t.Fatalf("breaker state = %v, want Open after HalfOpen trial fails", b.state)
+	}
+}
+
+func TestBreakerSuccessClosesAndResets(t *testing.T) {
+	b := NewBreaker(2, time.Hour, nil)
+	b.RecordFailure()
+	b.RecordSuccess()
+	if b.state != Closed {
+		t.Fatalf("breaker state = %v, want Closed", b.state)
+	}
+	if b.consecutiveFail != 0 {
+		t.Fatalf("consecutiveFail = %d, want 0 after RecordSuccess", b.consecutiveFail)
+	}
+
+	// Failure count should have reset, so it takes a full threshold of
+	// failures again to trip, not just one more.
+	b.RecordFailure()
+	if b.state != Closed {
+		t.Fatalf("breaker state = %v, want Closed after a single failure post-reset", b.state)
+	}
+}
+
+func TestStateString(t *testing.T) {
+	tests := []struct {
+		state State
+		want  string
+	}{
+		{Closed, "closed"},
+		{Open, "open"},
+		{HalfOpen, "half-open"},
+		{State(99), "unknown"},
+	}
+	for _, tc := range tests {
+		if got := tc.state.String(); got != tc.want {
+			t.Errorf("State(%d).String() = %q, want %q", tc.state, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package resilience
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+// Retry calls fn up to attempts times, sleeping a jittered exponential
+// backoff (base, 2*base, 4*base, ... capped at maxDelay) between tries.
+// It stops early if ctx is cancelled or fn succeeds, and returns fn's
+// last error otherwise.
+func Retry(ctx context.Context, attempts int, base, maxDelay time.Duration, fn func() error) error {
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt == attempts-1 {
+			break
+		}
+
+		delay := base << attempt
+		if delay <= 0 || delay > maxDelay {
+			delay = maxDelay
+		}
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2+1))) // jitter in [delay/2, delay]
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return err
+}
@@ -0,0 +1,56 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetrySucceedsWithoutExhaustingAttempts(t *testing.T) {
+	calls := 0
+	err := Retry(context.Background(), 5, time.Millisecond, 10*time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Retry() = %v, want nil", err)
+	}
+	if calls != 3 {
+		t.Fatalf("fn called %d times, want 3", calls)
+	}
+}
+
+func TestRetryReturnsLastErrorAfterExhausting(t *testing.T) {
+	wantErr := errors.New("still failing")
+	calls := 0
+	err := Retry(context.Background(), 3, time.Millisecond, 10*time.Millisecond, func() error {
+		calls++
+		return wantErr
+	})
+	if !errors.Is(err, wantErr) {
+		t.Fatalf("Retry() = %v, want %v", err, wantErr)
+	}
+	if calls != 3 {
+		t.Fatalf("fn called %d times, want 3 (attempts exhausted)", calls)
+	}
+}
+
+func TestRetryStopsOnContextCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	cancel()
+	err := Retry(ctx, 5, 10*time.Millisecond, 100*time.Millisecond, func() error {
+		calls++
+		return errors.New("fail")
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Retry() = %v, want context.Canceled", err)
+	}
+	if calls != 1 {
+		t.Fatalf("fn called %d times, want 1 (cancelled before first sleep)", calls)
+	}
+}
@@ -0,0 +1,42 @@
+package telemetry
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceHandler wraps a slog.Handler and adds trace_id/span_id attributes
+// from the context's active span, so log lines can be correlated with
+// the trace that produced them.
+type traceHandler struct {
+	slog.Handler
+}
+
+func (h traceHandler) Handle(ctx context.Context, record slog.Record) error {
+	if span := trace.SpanFromContext(ctx); span.SpanContext().IsValid() {
+		sc := span.SpanContext()
+		record.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h traceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return traceHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h traceHandler) WithGroup(name string) slog.Handler {
+	return traceHandler{h.Handler.WithGroup(name)}
+}
+
+// NewLogger returns the structured logger EdgeGuard uses in place of
+// log.Printf: JSON output with trace/span IDs attached whenever the log
+// call carries a context with an active span.
+func NewLogger() *slog.Logger {
+	return slog.New(traceHandler{slog.NewJSONHandler(os.Stdout, nil)})
+}
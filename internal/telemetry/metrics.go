@@ -0,0 +1,94 @@
+// Package telemetry gives EdgeGuard its Prometheus metrics, OpenTelemetry
+// tracing, and structured slog logging, so an operator can tell whether
+// the agent is actually polling, how long HAL calls take, and why a
+// deprovision fired without reading the source.
+package telemetry
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// HWIDChecksTotal counts every fingerprint computed, one per poll
+	// iteration.
+	HWIDChecksTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "edgeguard_hwid_checks_total",
+		Help: "Total number of hardware fingerprint checks performed.",
+	})
+
+	// HALFetchDuration tracks how long each HAL endpoint took to
+	// respond.
+	HALFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "edgeguard_hal_fetch_duration_seconds",
+		Help: "Duration of HAL endpoint fetches, by endpoint.",
+	}, []string{"endpoint"})
+
+	// HWIDMismatchTotal counts how many times the computed fingerprint
+	// differed from the stored baseline in a way that warns or
+	// deprovisions; changes only to "ignore"-policy components are not
+	// counted.
+	HWIDMismatchTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "edgeguard_hwid_mismatch_total",
+		Help: "Total number of hardware fingerprint mismatches detected.",
+	})
+
+	// DeprovisionAttemptsTotal counts deprovision attempts by outcome
+	// ("success" or "error").
+	DeprovisionAttemptsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "edgeguard_deprovision_attempts_total",
+		Help: "Total number of deprovision attempts, by result.",
+	}, []string{"result"})
+
+	// LastCheckTimestamp is the Unix time of the last successful
+	// fingerprint check.
+	LastCheckTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "edgeguard_last_check_timestamp_seconds",
+		Help: "Unix timestamp of the last successful hardware check.",
+	})
+
+	// CurrentPeriod is the configured poll interval in seconds, so
+	// operators can confirm PERIOD took effect.
+	CurrentPeriod = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "edgeguard_current_period_seconds",
+		Help: "Configured polling period in seconds.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		HWIDChecksTotal,
+		HALFetchDuration,
+		HWIDMismatchTotal,
+		DeprovisionAttemptsTotal,
+		LastCheckTimestamp,
+		CurrentPeriod,
+	)
+}
+
+// StartMetricsServer serves /metrics on addr (e.g. ":9090") in the
+// background. The returned server can be shut down by the caller; a
+// failure to bind is logged but not fatal, since metrics are an
+// observability concern, not a correctness one.
+func StartMetricsServer(addr string, errLog func(format string, args ...interface{})) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errLog("metrics server stopped: %v", err)
+		}
+	}()
+
+	return srv
+}
+
+// Shutdown is a convenience wrapper so callers don't need to import
+// net/http just to stop the metrics server.
+func Shutdown(ctx context.Context, srv *http.Server) error {
+	return srv.Shutdown(ctx)
+}
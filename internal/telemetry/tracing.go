@@ -0,0 +1,49 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+// Tracer is the tracer every instrumented EdgeGuard function starts
+// spans from.
+var Tracer = otel.Tracer("github.com/Datasance/EdgeGuard")
+
+// InitTracer wires up an OTLP exporter when OTEL_EXPORTER_OTLP_ENDPOINT
+// is set, and installs it as the global tracer provider. When the env
+// var is unset it installs nothing (otel's default no-op tracer keeps
+// every Tracer.Start call cheap and side-effect-free). The returned
+// shutdown func must be called before the process exits so buffered
+// spans get flushed.
+func InitTracer(ctx context.Context) (shutdown func(context.Context) error, err error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("edgeguard-agent"),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
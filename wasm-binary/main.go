@@ -2,36 +2,46 @@ package main
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"context"
+	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
+
 	"github.com/stealthrocket/net/wasip1"
+
+	"github.com/Datasance/EdgeGuard/collector"
+	"github.com/Datasance/EdgeGuard/internal/challenge"
+	"github.com/Datasance/EdgeGuard/internal/fingerprint"
+	"github.com/Datasance/EdgeGuard/internal/telemetry"
 )
 
+// This WASI build shares EdgeGuard's collector/fingerprint/challenge
+// packages with go-binary, so it gets the same timeouts, retries,
+// per-component tolerance, and signed re-enrollment challenge instead
+// of maintaining a second, drifting copy of that logic. TPM attestation
+// and the Prometheus/OTel metrics server are intentionally left out:
+// neither a TPM device nor a listening HTTP server is something a WASI
+// sandbox can be expected to provide.
 const (
-	defaultHALURL = "iofog"
-	defaultPort   = "54331"
-	deprovisionURL = "http://iofog:54321/v2/deprovision"
-	defaultPeriod = 60 // Default to 10 minutes if PERIOD is not set
+	defaultHALURL      = "iofog"
+	deprovisionURL     = "http://iofog:54321/v2/deprovision"
+	defaultPeriod      = 60 // Default to 1 minute if PERIOD is not set
+	saltFile           = "id/salt-key"
+	componentsFile     = "id/hw-components.json"
+	agentKeyFile       = "id/agent-key"
+	deprovisionScore   = 0 // any changed "deprovision"-policy component triggers deprovisioning
+	defaultMaxAttempts = 5 // default MAX_CHALLENGE_ATTEMPTS
+	challengeBaseDelay = 5 * time.Second
+	challengeMaxDelay  = 5 * time.Minute
 )
 
-type HardwareData struct {
-	Lscpu   map[string]interface{} `json:"lscpu"`
-	Lspci   map[string]interface{} `json:"lspci"`
-	Lsusb   map[string]interface{} `json:"lsusb"`
-	Lshw    map[string]interface{} `json:"lshw"`
-	CpuInfo map[string]interface{} `json:"cpuinfo"`
-}
-
-var salt string // Global variable to hold the salt in memory
+var logger = telemetry.NewLogger()
 
 func getEnv(key, fallback string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -40,107 +50,80 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
-func fetchEndpoint(url string) (interface{}, error) {
-	resp, err := http.Get(url)
+func generateSalt() (string, error) {
+	salt := make([]byte, 16) // 16-byte salt
+	_, err := rand.Read(salt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+		return "", fmt.Errorf("failed to generate salt: %w", err)
 	}
-	defer resp.Body.Close()
+	return base64.StdEncoding.EncodeToString(salt), nil
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response from %s: %w", url, err)
-	}
+func saveToFile(filename, data string) error {
+	return ioutil.WriteFile(filename, []byte(data), 0600)
+}
 
-	var data interface{}
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON from %s: %w", url, err)
+func loadFromFile(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
 	}
-
-	return data, nil
+	return string(bytes.TrimSpace(data)), nil
 }
 
-func collectHardwareData(baseURL string) (*HardwareData, error) {
-	endpoints := []string{"lscpu", "lspci", "lsusb", "lshw", "proc/cpuinfo"}
-	data := &HardwareData{}
-
-	for _, endpoint := range endpoints {
-		url := fmt.Sprintf("http://%s:%s/hal/hwc/%s", baseURL, defaultPort, endpoint)
-		result, err := fetchEndpoint(url)
-		if err != nil {
-			return nil, err
-		}
-
-		switch endpoint {
-		case "lscpu":
-			if resultMap, ok := result.(map[string]interface{}); ok {
-				data.Lscpu = resultMap
-			} else {
-				data.Lscpu = map[string]interface{}{"data": result}
-			}
-		case "lspci":
-			if resultMap, ok := result.(map[string]interface{}); ok {
-				data.Lspci = resultMap
-			} else {
-				data.Lspci = map[string]interface{}{"data": result}
-			}
-		case "lsusb":
-			if resultMap, ok := result.(map[string]interface{}); ok {
-				data.Lsusb = resultMap
-			} else {
-				data.Lsusb = map[string]interface{}{"data": result}
-			}
-		case "lshw":
-			if resultMap, ok := result.(map[string]interface{}); ok {
-				data.Lshw = resultMap
-			} else {
-				data.Lshw = map[string]interface{}{"data": result}
-			}
-		case "proc/cpuinfo":
-			if resultMap, ok := result.(map[string]interface{}); ok {
-				data.CpuInfo = resultMap
-			} else {
-				data.CpuInfo = map[string]interface{}{"data": result}
-			}
-		}
+// loadOrCreateSalt returns the persisted salt, generating and saving a
+// new one on first run.
+func loadOrCreateSalt() (string, error) {
+	salt, err := loadFromFile(saltFile)
+	if err == nil {
+		return salt, nil
 	}
 
-	return data, nil
-}
-
-// Generate a random salt
-func generateSalt() (string, error) {
-	salt := make([]byte, 16) // 16-byte salt
-	_, err := rand.Read(salt)
+	logger.Info("salt not found, generating new one")
+	salt, err = generateSalt()
 	if err != nil {
 		return "", fmt.Errorf("failed to generate salt: %w", err)
 	}
-	return base64.StdEncoding.EncodeToString(salt), nil
+	if err := saveToFile(saltFile, salt); err != nil {
+		return "", fmt.Errorf("failed to save salt to file: %w", err)
+	}
+	return salt, nil
 }
 
-// Calculate the salted hash of the hardware data
-func calculateSaltedHash(data *HardwareData) (string, error) {
-	// Marshal the hardware data to JSON
-	jsonData, err := json.Marshal(data)
-	if err != nil {
-		return "", fmt.Errorf("failed to serialize hardware data: %w", err)
-	}
+// runChallenge asks the controller whether a hardware change from
+// oldHWID to newHWID should be accepted. It returns true if the
+// controller approved the change (the caller should adopt newHWID as
+// the baseline), false if it was rejected or confirmation attempts were
+// exhausted (the caller should deprovision).
+func runChallenge(ctx context.Context, priv ed25519.PrivateKey, oldHWID, newHWID string, diffs []fingerprint.ComponentDiff, maxAttempts int) (bool, error) {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		req, err := challenge.NewRequest(priv, oldHWID, newHWID, diffs)
+		if err != nil {
+			return false, fmt.Errorf("failed to build challenge request: %w", err)
+		}
 
-	// If salt is empty, generate a new one
-	if salt == "" {
-		var err error
-		salt, err = generateSalt()
+		resp, err := challenge.Post(getEnv("CHALLENGE_URL", "http://iofog:54321/v2/hwid-challenge"), req)
 		if err != nil {
-			return "", fmt.Errorf("failed to generate salt: %w", err)
+			logger.ErrorContext(ctx, "error posting re-enrollment challenge", "attempt", attempt+1, "max_attempts", maxAttempts, "error", err)
+			time.Sleep(challenge.Backoff(attempt, challengeBaseDelay, challengeMaxDelay))
+			continue
 		}
-	}
 
-	// Combine the salt and hardware data
-	saltedData := append([]byte(salt), jsonData...)
+		switch resp.Decision {
+		case challenge.DecisionApprove:
+			return true, nil
+		case challenge.DecisionReject:
+			return false, nil
+		case challenge.DecisionConfirm:
+			logger.InfoContext(ctx, "re-enrollment challenge pending operator confirmation", "attempt", attempt+1, "max_attempts", maxAttempts)
+			time.Sleep(challenge.Backoff(attempt, challengeBaseDelay, challengeMaxDelay))
+		default:
+			return false, fmt.Errorf("unknown challenge decision %q", resp.Decision)
+		}
+	}
 
-	// Calculate the SHA256 hash of the salted data
-	hash := sha256.Sum256(saltedData)
-	return fmt.Sprintf("%x", hash), nil
+	logger.WarnContext(ctx, "re-enrollment challenge exhausted attempts without confirmation; proceeding to deprovision", "max_attempts", maxAttempts)
+	return false, nil
 }
 
 func loadAuthToken() (string, error) {
@@ -151,15 +134,14 @@ func loadAuthToken() (string, error) {
 	return string(bytes.TrimSpace(token)), nil
 }
 
-func deprovisionDevice(authToken string) error {
-	req, err := http.NewRequest(http.MethodDelete, deprovisionURL, nil)
+func deprovisionDevice(ctx context.Context, authToken string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, deprovisionURL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to create DELETE request: %w", err)
 	}
 	req.Header.Set("Authorization", authToken)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to send DELETE request: %w", err)
 	}
@@ -172,6 +154,17 @@ func deprovisionDevice(authToken string) error {
 	return nil
 }
 
+// logChangedComponents reports which components drifted and under
+// which policy, so an operator reading the log can tell a USB blip
+// from a CPU swap without digging into id/hw-components.json.
+func logChangedComponents(ctx context.Context, diffs []fingerprint.ComponentDiff) {
+	for _, d := range diffs {
+		if d.Changed {
+			logger.InfoContext(ctx, "hardware component changed", "component", d.Name, "policy", d.Policy, "weight", d.Weight)
+		}
+	}
+}
+
 func init() {
 	// Initialize WASI-compatible transport
 	if t, ok := http.DefaultTransport.(*http.Transport); ok {
@@ -179,55 +172,127 @@ func init() {
 	}
 }
 
-
 func main() {
+	ctx := context.Background()
+
 	halURL := getEnv("HAL_URL", defaultHALURL)
 	periodEnv := getEnv("PERIOD", strconv.Itoa(defaultPeriod))
 	period, err := strconv.Atoi(periodEnv)
 	if err != nil || period <= 0 {
-		log.Printf("Invalid PERIOD value, using default: %d seconds", defaultPeriod)
+		logger.Warn("invalid PERIOD value, using default", "default_seconds", defaultPeriod)
 		period = defaultPeriod
 	}
 
-	var initialHdID string
+	hwCollector, err := collector.New(getEnv("COLLECTOR", "hal"), halURL)
+	if err != nil {
+		logger.Error("invalid COLLECTOR configuration", "error", err)
+		os.Exit(1)
+	}
+
+	tolerance, err := fingerprint.ParseTolerance(getEnv("TOLERANCE", ""))
+	if err != nil {
+		logger.Error("invalid TOLERANCE configuration", "error", err)
+		os.Exit(1)
+	}
+
+	salt, err := loadOrCreateSalt()
+	if err != nil {
+		logger.Error("error loading salt", "error", err)
+		os.Exit(1)
+	}
+
+	baseline, err := fingerprint.LoadBaseline(componentsFile)
+	if err != nil {
+		logger.Error("error loading component baseline", "error", err)
+		os.Exit(1)
+	}
+
+	agentKey, err := challenge.LoadOrCreateKey(agentKeyFile)
+	if err != nil {
+		logger.Error("error loading agent key", "error", err)
+		os.Exit(1)
+	}
+
+	maxAttemptsEnv := getEnv("MAX_CHALLENGE_ATTEMPTS", strconv.Itoa(defaultMaxAttempts))
+	maxAttempts, err := strconv.Atoi(maxAttemptsEnv)
+	if err != nil || maxAttempts <= 0 {
+		logger.Warn("invalid MAX_CHALLENGE_ATTEMPTS value, using default", "default", defaultMaxAttempts)
+		maxAttempts = defaultMaxAttempts
+	}
 
 	for {
-		hardwareData, err := collectHardwareData(halURL)
+		hardwareData, err := hwCollector.Collect(ctx)
 		if err != nil {
-			log.Printf("Error collecting hardware data: %v", err)
+			logger.Error("error collecting hardware data", "error", err)
+			time.Sleep(time.Duration(period) * time.Second) // avoid busy-looping while HAL/collector is unhealthy
 			continue
 		}
 
-		hwID, err := calculateSaltedHash(hardwareData)
+		fp, err := fingerprint.Compute(ctx, hardwareData, salt, tolerance)
 		if err != nil {
-			log.Printf("Error calculating hardware hash: %v", err)
+			logger.Error("error computing hardware fingerprint", "error", err)
+			time.Sleep(time.Duration(period) * time.Second)
 			continue
 		}
-		log.Printf("Calculated hardware hash: %s", hwID)
+		logger.Info("computed hardware fingerprint", "hwid", fp.CompositeID)
 
-		if initialHdID == "" {
-			initialHdID = hwID
-			log.Println("Initial hardware ID set.")
+		if baseline == nil {
+			baseline = fp
+			if err := fingerprint.SaveBaseline(componentsFile, fp); err != nil {
+				logger.Error("error saving component baseline", "error", err)
+			}
+			logger.Info("initial hardware component baseline set")
+			time.Sleep(time.Duration(period) * time.Second)
 			continue
 		}
 
-		if hwID != initialHdID {
+		diffs := fingerprint.Diff(baseline, fp)
+		switch fingerprint.Aggregate(diffs, deprovisionScore) {
+		case fingerprint.ActionDeprovision:
+			logChangedComponents(ctx, diffs)
+
+			approved, err := runChallenge(ctx, agentKey, baseline.CompositeID, fp.CompositeID, diffs, maxAttempts)
+			if err != nil {
+				logger.Error("error running re-enrollment challenge", "error", err)
+				time.Sleep(time.Duration(period) * time.Second)
+				continue
+			}
+			if approved {
+				logger.Info("controller approved hardware change; updating baseline")
+				baseline = fp
+				if err := fingerprint.SaveBaseline(componentsFile, fp); err != nil {
+					logger.Error("error saving component baseline", "error", err)
+				}
+				break
+			}
+
 			authToken, err := loadAuthToken()
 			if err != nil {
-				log.Printf("Error loading auth token: %v", err)
+				logger.Error("error loading auth token", "error", err)
+				time.Sleep(time.Duration(period) * time.Second)
 				continue
 			}
 
-			if err := deprovisionDevice(authToken); err != nil {
-				log.Printf("Error deprovisioning device: %v", err)
+			if err := deprovisionDevice(ctx, authToken); err != nil {
+				logger.Error("error deprovisioning device", "error", err)
+				time.Sleep(time.Duration(period) * time.Second)
 				continue
 			}
 
-			log.Println("Device deprovisioned due to hardware changes.")
-			break
+			logger.Info("device deprovisioned due to hardware changes")
+			return
+
+		case fingerprint.ActionWarn:
+			logChangedComponents(ctx, diffs)
+			baseline = fp
+			if err := fingerprint.SaveBaseline(componentsFile, fp); err != nil {
+				logger.Error("error saving component baseline", "error", err)
+			}
+
+		default:
+			logger.Info("hardware configuration unchanged")
 		}
 
-		log.Println("Hardware configuration unchanged.")
 		time.Sleep(time.Duration(period) * time.Second) // Periodic check interval
 	}
 }